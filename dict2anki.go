@@ -1,26 +1,120 @@
 package main
 
 import (
+	"bufio"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"flag"
 	"github.com/atselvan/ankiconnect"
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
 	"io"
 	"net/http"
 	"os"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+	"unicode"
 )
 
+// dict2ankiModelName is the note model created on first run when the user
+// hasn't configured one explicitly.
+const dict2ankiModelName = "dict2anki"
+
+// dict2ankiModelFields lists the fields on the dict2anki note model, in
+// display order. SenseID isn't shown on the cards themselves but lets
+// checkDeckForDuplicate key on word + sense so multiple senses of the same
+// headword can coexist in the deck.
+var dict2ankiModelFields = []string{"Front", "Pronunciation", "PartOfSpeech", "Definitions", "Examples", "Audio", "SenseID"}
+
+// SenseSelectionMode controls how processWord narrows down the senses
+// Merriam-Webster returns for a headword (e.g. "lead" as noun vs. verb).
+type SenseSelectionMode int
+
+const (
+	// SelectInteractive prompts the user to choose one or more senses.
+	SelectInteractive SenseSelectionMode = iota
+	// SelectAll adds every sense as a separate card, skipping the prompt.
+	SelectAll
+	// SelectFirst keeps the pre-disambiguation behavior of taking only the
+	// first sense, for scripting.
+	SelectFirst
+)
+
+// defaultMaxConcurrency is used when Config.MaxConcurrency is unset.
+const defaultMaxConcurrency = 4
+
 type Config struct {
-	APIKey   string `json:"apiKey"`
-	DeckName string `json:"deckName"`
+	APIKey         string           `json:"apiKey"`
+	DeckName       string           `json:"deckName"`
+	ModelName      string           `json:"modelName"`
+	MaxConcurrency int              `json:"maxConcurrency"`
+	Providers      []ProviderConfig `json:"providers"`
+	Merge          bool             `json:"merge"`
+}
+
+// ProviderConfig names one entry in the provider fallback chain. Type is one
+// of "mw-collegiate", "mw-learners", or "wiktionary".
+type ProviderConfig struct {
+	Type string `json:"type"`
 }
 
 type Card struct {
-	Word         string
-	PartOfSpeech string   `json:"fl"`
-	Definitions  []string `json:"shortdef"`
+	Word          string
+	PartOfSpeech  string   `json:"fl"`
+	Definitions   []string `json:"shortdef"`
+	Pronunciation string
+	Examples      []string
+	AudioURL      string
+	// SenseID distinguishes homograph senses of the same Word, e.g.
+	// "lead:1" (noun) vs. "lead:2" (verb).
+	SenseID string
+}
+
+// ErrNoDefinition is returned by a DictionaryProvider when the word is
+// unknown to it, so callers can fall back to the next provider instead of
+// treating it as a fatal error.
+var ErrNoDefinition = errors.New("no definition found")
+
+// DictionaryProvider looks up a single word and returns a Card describing
+// it, or ErrNoDefinition if the provider has nothing for that word.
+type DictionaryProvider interface {
+	Lookup(word string) (Card, error)
+}
+
+// MultiSenseProvider is implemented by providers that can return every
+// sense a source has for a headword (e.g. "lead" as noun vs. verb, or
+// numbered homographs "lead:1", "lead:2"), instead of just the first.
+type MultiSenseProvider interface {
+	LookupAll(word string) ([]Card, error)
+}
+
+// Summary is the machine-readable result of a batch run, emitted as JSON
+// when --json is passed.
+type Summary struct {
+	Added   int      `json:"added"`
+	Skipped int      `json:"skipped"`
+	Queued  int      `json:"queued"`
+	Failed  int      `json:"failed"`
+	Errors  []string `json:"errors"`
+}
+
+// senseOutcome carries the result of adding (or skipping, or failing to
+// add) one selected sense of a word.
+type senseOutcome struct {
+	label  string // word, or word:sense-id when disambiguating homographs
+	status string
+	err    error
+}
+
+// wordResult carries every senseOutcome produced while processing a single
+// word back to the collecting goroutine in processWords.
+type wordResult struct {
+	word     string
+	outcomes []senseOutcome
 }
 
 func printHelp() {
@@ -28,7 +122,26 @@ func printHelp() {
 
 Usage:
 
-        dict2anki <word>
+        dict2anki <word> [<word>...]
+        dict2anki -              (reads one word per line from stdin)
+        dict2anki sync [--dry-run]
+
+Flags:
+
+        --json     emit a machine-readable JSON summary instead of text output
+        --all      add every sense of a headword as a separate card, skipping the disambiguation prompt
+        --first    always take the first sense of a headword, skipping the disambiguation prompt
+
+If Anki or Merriam-Webster is unreachable, words are queued to
+~/.local/share/dict2anki/queue.db instead of being dropped. Run
+"dict2anki sync" later, once both are reachable, to drain the queue.
+
+Without --all or --first, words are processed one at a time so the
+disambiguation prompt can be answered in order; for a large batch, pass
+--all or --first to process concurrently. Feeding a word list via
+"dict2anki -" and disambiguating interactively reads prompts from the
+controlling terminal rather than stdin, since stdin is already spoken
+for by the word list.
 
 Note:
 
@@ -59,44 +172,431 @@ func LoadConfig() (Config, error) {
 	return newConfig, nil
 }
 
-func parseResponse(responseBody io.ReadCloser) (Card, error) {
-	cardJson, err := io.ReadAll(responseBody)
+// readWords expands the command-line word list into a flat slice, reading
+// one word per line from stdin when the sole argument is "-". The second
+// return value reports whether the words were read from stdin, since that
+// stream is then no longer available for processWords to prompt on.
+func readWords(args []string) ([]string, bool, error) {
+	if len(args) == 1 && args[0] == "-" {
+		var words []string
+
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			word := strings.TrimSpace(scanner.Text())
+			if word == "" {
+				continue
+			}
+			words = append(words, word)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, true, err
+		}
+
+		return words, true, nil
+	}
+
+	return args, false, nil
+}
+
+// mwEntry mirrors the subset of a Merriam-Webster API entry needed to
+// build a Card: the headword pronunciation audio under hwi.prs, and the
+// dt example sentences nested inside def.sseq.
+type mwEntry struct {
+	Meta struct {
+		ID string `json:"id"`
+	} `json:"meta"`
+	PartOfSpeech string   `json:"fl"`
+	Definitions  []string `json:"shortdef"`
+	HeadwordInfo struct {
+		Pronunciations []struct {
+			Pronunciation string `json:"mw"`
+			Sound         struct {
+				Audio string `json:"audio"`
+			} `json:"sound"`
+		} `json:"prs"`
+	} `json:"hwi"`
+	DefinedSenses []struct {
+		SenseSequence [][]json.RawMessage `json:"sseq"`
+	} `json:"def"`
+}
+
+// mwVisMarkupPattern strips the {wi}...{/wi} headword-highlight markup
+// Merriam-Webster embeds in example sentences.
+var mwVisMarkupPattern = regexp.MustCompile(`\{wi\}(.*?)\{/wi\}`)
+
+// parseSenseExamples walks one sense's "dt" entries (tagged [kind, payload]
+// pairs) and collects the "vis" example-sentence text.
+func parseSenseExamples(dt []json.RawMessage) []string {
+	var examples []string
+
+	for _, raw := range dt {
+		var pair []json.RawMessage
+		if err := json.Unmarshal(raw, &pair); err != nil || len(pair) != 2 {
+			continue
+		}
+
+		var kind string
+		if err := json.Unmarshal(pair[0], &kind); err != nil || kind != "vis" {
+			continue
+		}
+
+		var examplesEntries []struct {
+			Text string `json:"t"`
+		}
+		if err := json.Unmarshal(pair[1], &examplesEntries); err != nil {
+			continue
+		}
+
+		for _, example := range examplesEntries {
+			examples = append(examples, mwVisMarkupPattern.ReplaceAllString(example.Text, "$1"))
+		}
+	}
+
+	return examples
+}
+
+// extractExamples walks entry.def[].sseq for "sense" nodes (skipping
+// "pseq"-nested parallel senses) and collects their example sentences.
+func extractExamples(entry mwEntry) []string {
+	var examples []string
+
+	for _, def := range entry.DefinedSenses {
+		for _, senseGroup := range def.SenseSequence {
+			for _, raw := range senseGroup {
+				var pair []json.RawMessage
+				if err := json.Unmarshal(raw, &pair); err != nil || len(pair) != 2 {
+					continue
+				}
+
+				var kind string
+				if err := json.Unmarshal(pair[0], &kind); err != nil || kind != "sense" {
+					continue
+				}
+
+				var sense struct {
+					Dt []json.RawMessage `json:"dt"`
+				}
+				if err := json.Unmarshal(pair[1], &sense); err != nil {
+					continue
+				}
+
+				examples = append(examples, parseSenseExamples(sense.Dt)...)
+			}
+		}
+	}
+
+	return examples
+}
+
+// buildAudioURL constructs a Merriam-Webster pronunciation audio URL from
+// an hwi.prs[].sound.audio filename, per MW's documented subdirectory
+// rules: "bix" and "gg" prefixes and leading digits/punctuation each get
+// their own subdirectory, everything else uses its first letter.
+func buildAudioURL(audioFile string) string {
+	var subdir string
+	switch {
+	case strings.HasPrefix(audioFile, "bix"):
+		subdir = "bix"
+	case strings.HasPrefix(audioFile, "gg"):
+		subdir = "gg"
+	case len(audioFile) > 0 && !unicode.IsLetter(rune(audioFile[0])):
+		subdir = "number"
+	default:
+		subdir = string(audioFile[0])
+	}
+
+	return "https://media.merriam-webster.com/audio/prons/en/us/mp3/" + subdir + "/" + audioFile + ".mp3"
+}
+
+// cardFromMWEntry builds a Card from a parsed Merriam-Webster entry,
+// including pronunciation, audio, and example sentences alongside the
+// part of speech and short definitions.
+func cardFromMWEntry(entry mwEntry) Card {
+	card := Card{
+		PartOfSpeech: entry.PartOfSpeech,
+		Definitions:  entry.Definitions,
+		Examples:     extractExamples(entry),
+		SenseID:      entry.Meta.ID,
+	}
+
+	if len(entry.HeadwordInfo.Pronunciations) > 0 {
+		pronunciation := entry.HeadwordInfo.Pronunciations[0]
+		card.Pronunciation = pronunciation.Pronunciation
+		if pronunciation.Sound.Audio != "" {
+			card.AudioURL = buildAudioURL(pronunciation.Sound.Audio)
+		}
+	}
+
+	return card
+}
+
+// decodeMerriamWebsterEntries parses a Merriam-Webster API response body
+// into its constituent entries (one per homograph sense). On an unknown
+// word, Merriam-Webster responds with a []string of spelling suggestions
+// instead of entries, which previously crashed on cards[0]; that shape is
+// now recognized and reported as ErrNoDefinition.
+func decodeMerriamWebsterEntries(responseBody io.ReadCloser) ([]mwEntry, error) {
+	body, err := io.ReadAll(responseBody)
 	if err != nil {
 		println("Error: Failed to read response body.")
-		return Card{}, err
+		return nil, err
 	}
 
-	var cards []Card
+	var entries []mwEntry
+	if err := json.Unmarshal(body, &entries); err == nil {
+		if len(entries) == 0 {
+			return nil, ErrNoDefinition
+		}
+		return entries, nil
+	}
+
+	var suggestions []string
+	if err := json.Unmarshal(body, &suggestions); err == nil {
+		return nil, ErrNoDefinition
+	}
+
+	println("Error: Failed to parse response body JSON.")
+	return nil, errors.New("unrecognized Merriam-Webster response shape")
+}
 
-	err = json.Unmarshal(cardJson, &cards)
+// requestMerriamWebsterEntries queries a Merriam-Webster dictionary
+// endpoint (Collegiate or Learner's share the same response shape) for word.
+func requestMerriamWebsterEntries(baseURL string, word string, key string) ([]mwEntry, error) {
+	response, err := http.Get(baseURL + word + "?key=" + key)
+	if err != nil {
+		println("Error: Failed to contact Merriam-Webster.")
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	return decodeMerriamWebsterEntries(response.Body)
+}
+
+// requestMerriamWebsterDefinition returns only the first sense Merriam-Webster
+// has for word, preserving the tool's original single-sense behavior.
+func requestMerriamWebsterDefinition(baseURL string, word string, key string) (Card, error) {
+	entries, err := requestMerriamWebsterEntries(baseURL, word, key)
 	if err != nil {
-		println("Error: Failed to parse response body JSON.")
 		return Card{}, err
 	}
 
-	return cards[0], nil
+	card := cardFromMWEntry(entries[0])
+	card.Word = word
+
+	return card, nil
 }
 
-func requestDefinition(word string, key string) (Card, error) {
-	response, err := http.Get("https://www.dictionaryapi.com/api/v3/references/collegiate/json/" + word + "?key=" + key)
+// requestMerriamWebsterDefinitions returns every sense Merriam-Webster has
+// for word, e.g. "lead" as a noun and as a verb.
+func requestMerriamWebsterDefinitions(baseURL string, word string, key string) ([]Card, error) {
+	entries, err := requestMerriamWebsterEntries(baseURL, word, key)
 	if err != nil {
-		println("Error: Failed to contact Merriam-Webster.")
+		return nil, err
+	}
+
+	cards := make([]Card, len(entries))
+	for i, entry := range entries {
+		cards[i] = cardFromMWEntry(entry)
+		cards[i].Word = word
+	}
+
+	return cards, nil
+}
+
+const (
+	mwCollegiateBaseURL = "https://www.dictionaryapi.com/api/v3/references/collegiate/json/"
+	mwLearnersBaseURL   = "https://www.dictionaryapi.com/api/v3/references/learners/json/"
+)
+
+// MerriamWebsterCollegiateProvider looks up words via the Merriam-Webster
+// Collegiate Dictionary API.
+type MerriamWebsterCollegiateProvider struct {
+	APIKey string
+}
+
+func (p MerriamWebsterCollegiateProvider) Lookup(word string) (Card, error) {
+	return requestMerriamWebsterDefinition(mwCollegiateBaseURL, word, p.APIKey)
+}
+
+func (p MerriamWebsterCollegiateProvider) LookupAll(word string) ([]Card, error) {
+	return requestMerriamWebsterDefinitions(mwCollegiateBaseURL, word, p.APIKey)
+}
+
+// MerriamWebsterLearnersProvider looks up words via the Merriam-Webster
+// Learner's Dictionary API, which tends to have simpler definitions.
+type MerriamWebsterLearnersProvider struct {
+	APIKey string
+}
+
+func (p MerriamWebsterLearnersProvider) Lookup(word string) (Card, error) {
+	return requestMerriamWebsterDefinition(mwLearnersBaseURL, word, p.APIKey)
+}
+
+func (p MerriamWebsterLearnersProvider) LookupAll(word string) ([]Card, error) {
+	return requestMerriamWebsterDefinitions(mwLearnersBaseURL, word, p.APIKey)
+}
+
+// wiktionaryTagPattern strips the HTML markup Wiktionary embeds in its
+// definition text (e.g. links to related terms).
+var wiktionaryTagPattern = regexp.MustCompile("<[^>]*>")
+
+// WiktionaryProvider looks up words via Wiktionary's REST API. It requires
+// no API key and serves as the last resort in the fallback chain.
+type WiktionaryProvider struct{}
+
+func (p WiktionaryProvider) Lookup(word string) (Card, error) {
+	response, err := http.Get("https://en.wiktionary.org/api/rest_v1/page/definition/" + word)
+	if err != nil {
+		println("Error: Failed to contact Wiktionary.")
 		return Card{}, err
 	}
+	defer response.Body.Close()
 
-	card, err := parseResponse(response.Body)
+	if response.StatusCode == http.StatusNotFound {
+		return Card{}, ErrNoDefinition
+	}
+
+	body, err := io.ReadAll(response.Body)
 	if err != nil {
-		println("Error: Failed to parse response")
+		println("Error: Failed to read response body.")
 		return Card{}, err
 	}
 
-	card.Word = word
+	// Wiktionary groups senses by language code, each holding a list of
+	// part-of-speech entries with HTML definitions.
+	var entriesByLanguage map[string][]struct {
+		PartOfSpeech string `json:"partOfSpeech"`
+		Definitions  []struct {
+			Definition string `json:"definition"`
+		} `json:"definitions"`
+	}
+
+	if err := json.Unmarshal(body, &entriesByLanguage); err != nil {
+		println("Error: Failed to parse Wiktionary response body JSON.")
+		return Card{}, err
+	}
+
+	entries, ok := entriesByLanguage["en"]
+	if !ok || len(entries) == 0 {
+		return Card{}, ErrNoDefinition
+	}
+
+	card := Card{Word: word, PartOfSpeech: entries[0].PartOfSpeech}
+	for _, def := range entries[0].Definitions {
+		card.Definitions = append(card.Definitions, wiktionaryTagPattern.ReplaceAllString(def.Definition, ""))
+	}
 
 	return card, nil
 }
 
-func checkDeckForDuplicate (client *ankiconnect.Client, word string, deck string) (bool, error) {
-	cards, restErr := client.Cards.Get(`"deck:` + deck +`" "front:` + word + `"` )
+// buildProviders assembles the fallback chain described by
+// config.Providers. An empty config falls back to the Collegiate API alone,
+// preserving the tool's previous single-provider behavior.
+func buildProviders(config Config) []DictionaryProvider {
+	if len(config.Providers) == 0 {
+		return []DictionaryProvider{MerriamWebsterCollegiateProvider{APIKey: config.APIKey}}
+	}
+
+	providers := make([]DictionaryProvider, 0, len(config.Providers))
+	for _, providerConfig := range config.Providers {
+		switch providerConfig.Type {
+		case "mw-collegiate":
+			providers = append(providers, MerriamWebsterCollegiateProvider{APIKey: config.APIKey})
+		case "mw-learners":
+			providers = append(providers, MerriamWebsterLearnersProvider{APIKey: config.APIKey})
+		case "wiktionary":
+			providers = append(providers, WiktionaryProvider{})
+		}
+	}
+
+	return providers
+}
+
+// lookupWord tries each provider in order, falling back to the next on
+// ErrNoDefinition or a network error. When merge is true, every provider
+// that succeeds contributes to the result instead of the chain stopping at
+// the first hit.
+func lookupWord(providers []DictionaryProvider, word string, merge bool) (Card, error) {
+	var merged Card
+	var lastErr error
+	found := false
+
+	for _, provider := range providers {
+		card, err := provider.Lookup(word)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		if !merge {
+			return card, nil
+		}
+
+		found = true
+		merged.Word = word
+		if merged.PartOfSpeech == "" {
+			merged.PartOfSpeech = card.PartOfSpeech
+		} else if card.PartOfSpeech != "" {
+			merged.PartOfSpeech += ", " + card.PartOfSpeech
+		}
+		merged.Definitions = append(merged.Definitions, card.Definitions...)
+		merged.Examples = append(merged.Examples, card.Examples...)
+		if merged.Pronunciation == "" {
+			merged.Pronunciation = card.Pronunciation
+		}
+		if merged.AudioURL == "" {
+			merged.AudioURL = card.AudioURL
+		}
+	}
+
+	if found {
+		return merged, nil
+	}
+	if lastErr != nil {
+		return Card{}, lastErr
+	}
+
+	return Card{}, ErrNoDefinition
+}
+
+// lookupWordSenses tries each provider in order, returning every sense the
+// first successful provider has for word. Providers that don't implement
+// MultiSenseProvider contribute at most one sense, via Lookup.
+func lookupWordSenses(providers []DictionaryProvider, word string) ([]Card, error) {
+	var lastErr error
+
+	for _, provider := range providers {
+		if multi, ok := provider.(MultiSenseProvider); ok {
+			cards, err := multi.LookupAll(word)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			return cards, nil
+		}
+
+		card, err := provider.Lookup(word)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return []Card{card}, nil
+	}
+
+	if lastErr != nil {
+		return nil, lastErr
+	}
+
+	return nil, ErrNoDefinition
+}
+
+func checkDeckForDuplicate (client *ankiconnect.Client, word string, senseID string, deck string) (bool, error) {
+	query := `"deck:` + deck + `" "front:` + word + `"`
+	if senseID != "" {
+		query += ` "SenseID:` + senseID + `"`
+	}
+
+	cards, restErr := client.Cards.Get(query)
 	if restErr != nil {
 		return false, errors.New("AnkiConnect error.")
 	}
@@ -108,17 +608,101 @@ func checkDeckForDuplicate (client *ankiconnect.Client, word string, deck string
 	return false, nil
 }
 
-func addCardToDeck(client *ankiconnect.Client, card Card, deck string) error {
-	note := ankiconnect.Note{
+// ensureModel makes sure the configured note model exists in Anki, creating
+// it via AnkiConnect's createModel action on first run.
+func ensureModel(client *ankiconnect.Client, modelName string) error {
+	modelNames, restErr := client.Models.GetAll()
+	if restErr != nil {
+		return errors.New("AnkiConnect error")
+	}
+
+	for _, name := range *modelNames {
+		if name == modelName {
+			return nil
+		}
+	}
+
+	template := ankiconnect.CardTemplate{
+		Name:  "Card 1",
+		Front: "{{Front}}<br>{{Pronunciation}}",
+		Back:  "{{FrontSide}}<hr id=answer>{{PartOfSpeech}}<br><br>{{Definitions}}<br><br>{{Examples}}<br><br>{{Audio}}",
+	}
+
+	model := ankiconnect.Model{
+		ModelName:     modelName,
+		InOrderFields: dict2ankiModelFields,
+		CardTemplates: []ankiconnect.CardTemplate{template},
+	}
+
+	if restErr := client.Models.Create(model); restErr != nil {
+		return errors.New("AnkiConnect error")
+	}
+
+	return nil
+}
+
+// fetchAudio downloads the pronunciation MP3 at url.
+func fetchAudio(url string) ([]byte, error) {
+	response, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	return io.ReadAll(response.Body)
+}
+
+// uploadAudio downloads card's pronunciation audio and stores it in Anki's
+// media collection via storeMediaFile, returning an Audio field value
+// ("[sound:...]") ready to drop into a note, or "" if no audio is available.
+// The filename is keyed on SenseID rather than Word so that multiple senses
+// of the same headword (e.g. "lead" noun vs. verb) don't silently overwrite
+// each other's pronunciation audio in Anki's media collection.
+func uploadAudio(client *ankiconnect.Client, card Card) string {
+	if card.AudioURL == "" {
+		return ""
+	}
+
+	audio, err := fetchAudio(card.AudioURL)
+	if err != nil {
+		println("Warning: Failed to download pronunciation audio for " + card.Word + ".")
+		return ""
+	}
+
+	filename := card.Word + ".mp3"
+	if card.SenseID != "" {
+		filename = card.SenseID + ".mp3"
+	}
+
+	_, restErr := client.Media.StoreMediaFile(filename, base64.StdEncoding.EncodeToString(audio))
+	if restErr != nil {
+		println("Warning: Failed to upload pronunciation audio for " + card.Word + ".")
+		return ""
+	}
+
+	return "[sound:" + filename + "]"
+}
+
+// buildNote turns card into an AnkiConnect note ready to add to deck, fetching
+// and uploading its pronunciation audio along the way.
+func buildNote(client *ankiconnect.Client, card Card, deck string, modelName string) ankiconnect.Note {
+	return ankiconnect.Note{
 		DeckName:  deck,
-		ModelName: "Basic",
+		ModelName: modelName,
 		Fields: ankiconnect.Fields{
-			"Front": cases.Title(language.AmericanEnglish).String(card.Word),
-			"Back":  card.PartOfSpeech + "<br><br>" + strings.Join(card.Definitions, "<br>"),
+			"Front":         cases.Title(language.AmericanEnglish).String(card.Word),
+			"Pronunciation": card.Pronunciation,
+			"PartOfSpeech":  card.PartOfSpeech,
+			"Definitions":   strings.Join(card.Definitions, "<br>"),
+			"Examples":      strings.Join(card.Examples, "<br>"),
+			"Audio":         uploadAudio(client, card),
+			"SenseID":       card.SenseID,
 		},
 	}
+}
 
-	restErr := client.Notes.Add(note)
+func addCardToDeck(client *ankiconnect.Client, card Card, deck string, modelName string) error {
+	restErr := client.Notes.Add(buildNote(client, card, deck, modelName))
 	if restErr != nil {
 		return errors.New("Ankiconnect error")
 	}
@@ -126,9 +710,550 @@ func addCardToDeck(client *ankiconnect.Client, card Card, deck string) error {
 	return nil
 }
 
+// queuedWord is one line of the offline queue written when a lookup can't be
+// delivered immediately because Anki or Merriam-Webster is unreachable.
+type queuedWord struct {
+	Word       string    `json:"word"`
+	EnqueuedAt time.Time `json:"enqueuedAt"`
+}
+
+// queuePaths returns the offline queue's directory and file path,
+// ~/.local/share/dict2anki/queue.db. Despite the name, the queue is stored
+// as newline-delimited JSON rather than SQLite, so it can be read and
+// repaired with a text editor if something goes wrong.
+func queuePaths() (dir string, file string, err error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", "", err
+	}
+
+	dir = home + "/.local/share/dict2anki"
+	return dir, dir + "/queue.db", nil
+}
+
+// enqueueWords appends words to the offline queue, creating it if this is
+// the first word queued.
+func enqueueWords(words []string) error {
+	dir, path, err := queuePaths()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	encoder := json.NewEncoder(f)
+	for _, word := range words {
+		if err := encoder.Encode(queuedWord{Word: word, EnqueuedAt: time.Now()}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loadQueue reads every word waiting in the offline queue. A missing queue
+// file isn't an error; it just means nothing has ever been queued.
+func loadQueue() ([]queuedWord, error) {
+	_, path, err := queuePaths()
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var queued []queuedWord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var qw queuedWord
+		if err := json.Unmarshal([]byte(line), &qw); err != nil {
+			continue
+		}
+		queued = append(queued, qw)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return queued, nil
+}
+
+// rewriteQueue replaces the offline queue's contents with queued, removing
+// the file entirely once it's empty.
+func rewriteQueue(queued []queuedWord) error {
+	_, path, err := queuePaths()
+	if err != nil {
+		return err
+	}
+
+	if len(queued) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	encoder := json.NewEncoder(f)
+	for _, qw := range queued {
+		if err := encoder.Encode(qw); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// syncMaxAttempts and syncInitialBackoff bound how hard runSync retries a
+// still-failing Merriam-Webster fetch before leaving the word queued for
+// the next sync.
+const (
+	syncMaxAttempts    = 4
+	syncInitialBackoff = 500 * time.Millisecond
+)
+
+// lookupWordWithBackoff retries a failing lookup with exponential backoff,
+// for use during sync where a transient Merriam-Webster outage shouldn't
+// immediately bounce a word back into the queue. A definitive
+// ErrNoDefinition isn't retried, since waiting won't change the answer.
+func lookupWordWithBackoff(providers []DictionaryProvider, word string, merge bool) (Card, error) {
+	backoff := syncInitialBackoff
+	var lastErr error
+
+	for attempt := 0; attempt < syncMaxAttempts; attempt++ {
+		card, err := lookupWord(providers, word, merge)
+		if err == nil {
+			return card, nil
+		}
+		if errors.Is(err, ErrNoDefinition) {
+			return Card{}, err
+		}
+
+		lastErr = err
+		if attempt < syncMaxAttempts-1 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+
+	return Card{}, lastErr
+}
+
+// runSync drains the offline queue: it retries each queued word's
+// dictionary lookup with exponential backoff, then adds everything that
+// succeeded to Anki. The ankiconnect client this tool depends on doesn't
+// expose the batched addNotes action, only Notes.Add for a single note, so
+// synced notes are still added one at a time. A word that still fails with
+// a transient error stays queued for next time; one that definitively has
+// no definition (ErrNoDefinition) is dropped instead, since retrying won't
+// change the answer.
+func runSync(args []string) {
+	syncFlags := flag.NewFlagSet("sync", flag.ExitOnError)
+	dryRun := syncFlags.Bool("dry-run", false, "look up queued words and report what would be synced, without contacting Anki or changing the queue")
+	syncFlags.Parse(args)
+
+	queued, err := loadQueue()
+	if err != nil {
+		println("Fatal: Failed to read the offline queue.")
+		return
+	}
+	if len(queued) == 0 {
+		println("Queue is empty.")
+		return
+	}
+
+	config, err := LoadConfig()
+	if err != nil {
+		println("Fatal: Failed to open config file.")
+		return
+	}
+	if config.ModelName == "" {
+		config.ModelName = dict2ankiModelName
+	}
+
+	var client *ankiconnect.Client
+	if !*dryRun {
+		client = ankiconnect.NewClient()
+		if err := client.Ping(); err != nil {
+			println("Fatal: Failed to connect to Anki. Is it running? Does it have AnkiConnect?")
+			return
+		}
+		if err := ensureModel(client, config.ModelName); err != nil {
+			println("Fatal: Failed to create the " + config.ModelName + " note model.")
+			return
+		}
+	}
+
+	providers := buildProviders(config)
+
+	var notes []ankiconnect.Note
+	var stillQueued []queuedWord
+	synced := 0
+
+	for _, qw := range queued {
+		card, err := lookupWordWithBackoff(providers, qw.Word, config.Merge)
+		if err != nil {
+			if errors.Is(err, ErrNoDefinition) {
+				println("No definition found for " + qw.Word + ", dropping it from the queue.")
+				continue
+			}
+			println("Still failing to fetch a definition for " + qw.Word + ", leaving it queued.")
+			stillQueued = append(stillQueued, qw)
+			continue
+		}
+
+		if *dryRun {
+			println("Would sync " + qw.Word + ".")
+			synced++
+			continue
+		}
+
+		duplicateExists, err := checkDeckForDuplicate(client, card.Word, card.SenseID, config.DeckName)
+		if err != nil {
+			println("Failed to query deck for duplicates for " + qw.Word + ", leaving it queued.")
+			stillQueued = append(stillQueued, qw)
+			continue
+		}
+		if duplicateExists {
+			println("Duplicate detected, dropping " + qw.Word + " from the queue.")
+			continue
+		}
+
+		notes = append(notes, buildNote(client, card, config.DeckName, config.ModelName))
+		synced++
+	}
+
+	if *dryRun {
+		println("Would sync " + strconv.Itoa(synced) + " word(s), " + strconv.Itoa(len(stillQueued)) + " would remain queued.")
+		return
+	}
+
+	for _, note := range notes {
+		if restErr := client.Notes.Add(note); restErr != nil {
+			println("Fatal: Failed to add synced notes to Anki.")
+			return
+		}
+	}
+
+	if err := rewriteQueue(stillQueued); err != nil {
+		println("Warning: Failed to update the offline queue.")
+	}
+
+	println("Synced " + strconv.Itoa(synced) + " word(s), " + strconv.Itoa(len(stillQueued)) + " still queued.")
+}
+
+// selectSenses narrows the senses a provider returned for a headword down
+// to the ones that should become cards: automatically (first sense, or
+// every sense) or by prompting the user to choose.
+func selectSenses(cards []Card, mode SenseSelectionMode, reader *bufio.Reader) ([]Card, error) {
+	if len(cards) <= 1 {
+		return cards, nil
+	}
+
+	switch mode {
+	case SelectFirst:
+		return cards[:1], nil
+	case SelectAll:
+		return cards, nil
+	default:
+		return promptForSenses(cards, reader)
+	}
+}
+
+// promptForSenses lists every sense returned for a headword (e.g. "lead"
+// as noun vs. verb) with its part of speech and first short definition,
+// and lets the user pick one or more by number to send to Anki.
+func promptForSenses(cards []Card, reader *bufio.Reader) ([]Card, error) {
+	println("Multiple entries found for \"" + cards[0].Word + "\":")
+	for i, card := range cards {
+		firstDefinition := ""
+		if len(card.Definitions) > 0 {
+			firstDefinition = card.Definitions[0]
+		}
+		println(strconv.Itoa(i+1) + ". (" + card.PartOfSpeech + ") " + firstDefinition)
+	}
+	println("Enter the numbers to add (e.g. \"1,3\"), or \"all\":")
+
+	line, err := reader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	line = strings.TrimSpace(line)
+
+	if line == "all" {
+		return cards, nil
+	}
+
+	var selected []Card
+	for _, field := range strings.Split(line, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		index, err := strconv.Atoi(field)
+		if err != nil || index < 1 || index > len(cards) {
+			continue
+		}
+
+		selected = append(selected, cards[index-1])
+	}
+
+	return selected, nil
+}
+
+// addSelectedCard checks one selected sense against the deck for
+// duplicates, keyed on word + sense ID so multiple senses of the same
+// headword can coexist, and adds it if it's new.
+func addSelectedCard(client *ankiconnect.Client, config Config, card Card, jsonOutput bool) senseOutcome {
+	label := card.Word
+	if card.SenseID != "" {
+		label = card.SenseID
+	}
+
+	if !jsonOutput {
+		println(card.Word)
+		println(card.PartOfSpeech)
+		println(strings.Join(card.Definitions, "\n"))
+	}
+
+	duplicateExists, err := checkDeckForDuplicate(client, card.Word, card.SenseID, config.DeckName)
+	if err != nil {
+		if !jsonOutput {
+			println("Failed to query deck for duplicates for " + label + ".")
+		}
+		return senseOutcome{label: label, status: "failed", err: err}
+	}
+
+	if duplicateExists {
+		if !jsonOutput {
+			println("Duplicate detected, omitting " + label + ".")
+		}
+		return senseOutcome{label: label, status: "skipped"}
+	}
+
+	if err := addCardToDeck(client, card, config.DeckName, config.ModelName); err != nil {
+		if !jsonOutput {
+			println("Failed to add " + label + " to deck.")
+		}
+		return senseOutcome{label: label, status: "failed", err: err}
+	}
+
+	if !jsonOutput {
+		println("Added " + label + ".")
+	}
+
+	return senseOutcome{label: label, status: "added"}
+}
+
+// processWord looks up a word, narrows its senses down per mode (prompting
+// for homographs unless --all or --first was given), and adds each
+// selected sense to the deck. It reports outcomes instead of exiting the
+// process, so it can be driven by a worker in processWords.
+func processWord(client *ankiconnect.Client, config Config, providers []DictionaryProvider, word string, mode SenseSelectionMode, reader *bufio.Reader, jsonOutput bool) []senseOutcome {
+	var cards []Card
+	var err error
+
+	if config.Merge {
+		var card Card
+		card, err = lookupWord(providers, word, true)
+		if err == nil {
+			cards = []Card{card}
+		}
+	} else {
+		cards, err = lookupWordSenses(providers, word)
+	}
+
+	if err != nil {
+		if errors.Is(err, ErrNoDefinition) {
+			if !jsonOutput {
+				println("No definition found for " + word + ".")
+			}
+			return []senseOutcome{{label: word, status: "failed", err: err}}
+		}
+
+		if enqueueErr := enqueueWords([]string{word}); enqueueErr == nil {
+			if !jsonOutput {
+				println("Failed to fetch definition for " + word + "; queued it for `dict2anki sync`.")
+			}
+			return []senseOutcome{{label: word, status: "queued"}}
+		}
+		if !jsonOutput {
+			println("Failed to fetch definition for " + word + ".")
+		}
+		return []senseOutcome{{label: word, status: "failed", err: err}}
+	}
+
+	selected, err := selectSenses(cards, mode, reader)
+	if err != nil {
+		if !jsonOutput {
+			println("Failed to read sense selection for " + word + ".")
+		}
+		return []senseOutcome{{label: word, status: "failed", err: err}}
+	}
+
+	if len(selected) == 0 {
+		if !jsonOutput {
+			println("No senses selected for " + word + ", skipping.")
+		}
+		return []senseOutcome{{label: word, status: "skipped"}}
+	}
+
+	outcomes := make([]senseOutcome, 0, len(selected))
+	for _, card := range selected {
+		outcomes = append(outcomes, addSelectedCard(client, config, card, jsonOutput))
+	}
+
+	return outcomes
+}
+
+// disambiguationInput picks the stream processWords should prompt on for
+// interactive sense selection. That's ordinarily stdin, but readWords
+// already drains stdin for the word list itself when invoked as
+// `dict2anki -`, so in that case the prompt has to come from the
+// controlling terminal instead, or there's no way for the user to ever
+// respond. It returns an error telling the caller to pass --all or --first
+// when no terminal is available to fall back to.
+func disambiguationInput(wordsFromStdin bool, mode SenseSelectionMode) (io.Reader, error) {
+	if !wordsFromStdin || mode != SelectInteractive {
+		return os.Stdin, nil
+	}
+
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return nil, errors.New("word list was read from stdin, so there's no stdin left to prompt on; pass --all or --first, or run interactively from a terminal")
+	}
+
+	return tty, nil
+}
+
+// effectiveConcurrency works out how many workers processWords should run:
+// config.MaxConcurrency (or defaultMaxConcurrency if unset), forced down to
+// one worker for interactive disambiguation since it reads from a single
+// promptInput stream, and capped at one worker per word so a small batch
+// doesn't start idle workers.
+func effectiveConcurrency(config Config, mode SenseSelectionMode, numWords int) int {
+	concurrency := config.MaxConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultMaxConcurrency
+	}
+	if mode == SelectInteractive {
+		concurrency = 1
+	}
+	if concurrency > numWords {
+		concurrency = numWords
+	}
+
+	return concurrency
+}
+
+// processWords runs word lookups across a bounded pool of workers, sized by
+// config.MaxConcurrency, so a batch of hundreds of words doesn't wait
+// serially on Merriam-Webster round-trips. Interactive disambiguation reads
+// from a single promptInput stream, so it forces the pool down to one
+// worker; pass --all or --first to process concurrently.
+func processWords(client *ankiconnect.Client, config Config, providers []DictionaryProvider, words []string, mode SenseSelectionMode, promptInput io.Reader, jsonOutput bool) Summary {
+	concurrency := effectiveConcurrency(config, mode, len(words))
+	if mode == SelectInteractive && !jsonOutput {
+		println("Interactive disambiguation reads one response at a time, so words are being processed serially; pass --all or --first to process concurrently.")
+	}
+
+	jobs := make(chan string)
+	results := make(chan wordResult)
+	reader := bufio.NewReader(promptInput)
+
+	var workers sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for word := range jobs {
+				outcomes := processWord(client, config, providers, word, mode, reader, jsonOutput)
+				results <- wordResult{word: word, outcomes: outcomes}
+			}
+		}()
+	}
+
+	go func() {
+		for _, word := range words {
+			jobs <- word
+		}
+		close(jobs)
+	}()
+
+	go func() {
+		workers.Wait()
+		close(results)
+	}()
+
+	summary := Summary{Errors: []string{}}
+	for result := range results {
+		for _, outcome := range result.outcomes {
+			switch outcome.status {
+			case "added":
+				summary.Added++
+			case "skipped":
+				summary.Skipped++
+			case "queued":
+				summary.Queued++
+			case "failed":
+				errMsg := outcome.label
+				if outcome.err != nil {
+					errMsg += ": " + outcome.err.Error()
+				}
+				summary.Failed++
+				summary.Errors = append(summary.Errors, errMsg)
+			}
+		}
+	}
+
+	return summary
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "sync" {
+		runSync(os.Args[2:])
+		return
+	}
+
+	jsonOutput := flag.Bool("json", false, "emit a machine-readable JSON summary ({added, skipped, queued, failed, errors}) instead of text output")
+	allSenses := flag.Bool("all", false, "add every sense of a headword as a separate card, skipping the disambiguation prompt")
+	firstSense := flag.Bool("first", false, "always take the first sense of a headword, skipping the disambiguation prompt")
+	flag.Parse()
+
+	mode := SelectInteractive
+	switch {
+	case *allSenses:
+		mode = SelectAll
+	case *firstSense:
+		mode = SelectFirst
+	}
+
 	// Validate arguments
-	if len(os.Args) == 0 {
+	if flag.NArg() == 0 {
 		printHelp()
 		return
 	}
@@ -140,42 +1265,53 @@ func main() {
 		return
 	}
 
-	// Connect to Anki
-	client := ankiconnect.NewClient()
-	restErr := client.Ping()
-	if restErr != nil {
-		println("Fatal: Failed to connect to Anki. Is it running? Does it have AnkiConnect?")
+	// Expand the word list from arguments or stdin
+	words, wordsFromStdin, err := readWords(flag.Args())
+	if err != nil {
+		println("Fatal: Failed to read word list from stdin.")
 		return
 	}
 
-	// Make our request
-	card, err := requestDefinition(os.Args[1], config.APIKey)
+	promptInput, err := disambiguationInput(wordsFromStdin, mode)
 	if err != nil {
-		println("Fatal: Failed to connect to Merriam-Webster and Wiktionary, or failed to parse response.")
+		println("Fatal: " + err.Error() + ".")
 		return
 	}
 
-	// Print card
-	println(card.Word)
-	println(card.PartOfSpeech)
-	println(strings.Join(card.Definitions, "\n"))
+	if config.ModelName == "" {
+		config.ModelName = dict2ankiModelName
+	}
 
-	// Check if the card is already in the Anki deck
-	duplicateExists, err := checkDeckForDuplicate(client, card.Word, config.DeckName)
-	if err != nil {
-		println("Fatal: Failed to query deck for duplicates.")
+	// Connect to Anki. If it's unreachable, queue the words for a later
+	// `dict2anki sync` instead of dropping them.
+	client := ankiconnect.NewClient()
+	if restErr := client.Ping(); restErr != nil {
+		if err := enqueueWords(words); err != nil {
+			println("Fatal: Anki is unreachable and the word list couldn't be queued.")
+			return
+		}
+		println("Anki is unreachable; queued " + strconv.Itoa(len(words)) + " word(s). Run `dict2anki sync` once it's reachable.")
 		return
 	}
 
-	if duplicateExists {
-		println("Duplicate detected, omitting.")
+	// Make sure the note model exists before we start adding cards to it
+	if err := ensureModel(client, config.ModelName); err != nil {
+		println("Fatal: Failed to create the " + config.ModelName + " note model.")
 		return
 	}
 
-	// Write to Anki deck
-	err = addCardToDeck(client, card, config.DeckName)
-	if err != nil {
-		println("Fatal: Failed to add card to deck.")
+	// Process the word list, fanning out across a bounded worker pool
+	providers := buildProviders(config)
+	summary := processWords(client, config, providers, words, mode, promptInput, *jsonOutput)
+
+	if *jsonOutput {
+		encoded, err := json.Marshal(summary)
+		if err != nil {
+			println("Fatal: Failed to encode JSON summary.")
+			return
+		}
+		os.Stdout.Write(encoded)
+		os.Stdout.Write([]byte("\n"))
 		return
 	}
 
@@ -0,0 +1,541 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/atselvan/ankiconnect"
+	bksterrors "github.com/privatesquare/bkst-go-utils/utils/errors"
+)
+
+func TestBuildAudioURL(t *testing.T) {
+	cases := []struct {
+		audioFile string
+		want      string
+	}{
+		{"bixocular", "https://media.merriam-webster.com/audio/prons/en/us/mp3/bix/bixocular.mp3"},
+		{"ggallop", "https://media.merriam-webster.com/audio/prons/en/us/mp3/gg/ggallop.mp3"},
+		{"1wordly", "https://media.merriam-webster.com/audio/prons/en/us/mp3/number/1wordly.mp3"},
+		{"word001", "https://media.merriam-webster.com/audio/prons/en/us/mp3/w/word001.mp3"},
+	}
+
+	for _, c := range cases {
+		if got := buildAudioURL(c.audioFile); got != c.want {
+			t.Errorf("buildAudioURL(%q) = %q, want %q", c.audioFile, got, c.want)
+		}
+	}
+}
+
+// stubProvider is a DictionaryProvider that returns a fixed Card or error,
+// for exercising lookupWord's fallback and merge logic without a network.
+type stubProvider struct {
+	card Card
+	err  error
+}
+
+func (s stubProvider) Lookup(word string) (Card, error) {
+	return s.card, s.err
+}
+
+func TestLookupWordFallsBackOnError(t *testing.T) {
+	providers := []DictionaryProvider{
+		stubProvider{err: ErrNoDefinition},
+		stubProvider{card: Card{PartOfSpeech: "noun"}},
+	}
+
+	card, err := lookupWord(providers, "word", false)
+	if err != nil {
+		t.Fatalf("lookupWord returned error: %v", err)
+	}
+	if card.PartOfSpeech != "noun" {
+		t.Errorf("card.PartOfSpeech = %q, want %q", card.PartOfSpeech, "noun")
+	}
+}
+
+func TestLookupWordReturnsLastErrorWhenAllFail(t *testing.T) {
+	wantErr := errors.New("network down")
+	providers := []DictionaryProvider{
+		stubProvider{err: ErrNoDefinition},
+		stubProvider{err: wantErr},
+	}
+
+	_, err := lookupWord(providers, "word", false)
+	if !errors.Is(err, wantErr) {
+		t.Errorf("lookupWord error = %v, want %v", err, wantErr)
+	}
+}
+
+func TestLookupWordMergesAcrossProviders(t *testing.T) {
+	providers := []DictionaryProvider{
+		stubProvider{card: Card{
+			PartOfSpeech: "noun",
+			Definitions:  []string{"a heavy metal"},
+			Examples:     []string{"the lead pipe"},
+		}},
+		stubProvider{card: Card{
+			PartOfSpeech:  "verb",
+			Definitions:   []string{"to guide"},
+			Pronunciation: "ˈlēd",
+			AudioURL:      "https://example.com/lead.mp3",
+		}},
+	}
+
+	card, err := lookupWord(providers, "lead", true)
+	if err != nil {
+		t.Fatalf("lookupWord returned error: %v", err)
+	}
+
+	if card.PartOfSpeech != "noun, verb" {
+		t.Errorf("card.PartOfSpeech = %q, want %q", card.PartOfSpeech, "noun, verb")
+	}
+	if len(card.Definitions) != 2 || card.Definitions[0] != "a heavy metal" || card.Definitions[1] != "to guide" {
+		t.Errorf("card.Definitions = %v, want [a heavy metal, to guide]", card.Definitions)
+	}
+	if card.Pronunciation != "ˈlēd" {
+		t.Errorf("card.Pronunciation = %q, want the second provider's pronunciation", card.Pronunciation)
+	}
+	if card.AudioURL != "https://example.com/lead.mp3" {
+		t.Errorf("card.AudioURL = %q, want the second provider's audio URL", card.AudioURL)
+	}
+}
+
+func TestLookupWordMergeSkipsFailingProviders(t *testing.T) {
+	providers := []DictionaryProvider{
+		stubProvider{err: ErrNoDefinition},
+		stubProvider{card: Card{PartOfSpeech: "noun", Definitions: []string{"a heavy metal"}}},
+	}
+
+	card, err := lookupWord(providers, "lead", true)
+	if err != nil {
+		t.Fatalf("lookupWord returned error: %v", err)
+	}
+	if card.PartOfSpeech != "noun" {
+		t.Errorf("card.PartOfSpeech = %q, want %q", card.PartOfSpeech, "noun")
+	}
+}
+
+func TestDecodeMerriamWebsterEntriesSpellingSuggestions(t *testing.T) {
+	body := io.NopCloser(strings.NewReader(`["sugestion", "suggestion", "suggestions"]`))
+
+	_, err := decodeMerriamWebsterEntries(body)
+	if !errors.Is(err, ErrNoDefinition) {
+		t.Errorf("decodeMerriamWebsterEntries error = %v, want ErrNoDefinition", err)
+	}
+}
+
+func TestDecodeMerriamWebsterEntriesMalformedBody(t *testing.T) {
+	body := io.NopCloser(strings.NewReader(`not valid json at all`))
+
+	_, err := decodeMerriamWebsterEntries(body)
+	if err == nil {
+		t.Fatal("decodeMerriamWebsterEntries returned no error for malformed JSON")
+	}
+	if errors.Is(err, ErrNoDefinition) {
+		t.Error("decodeMerriamWebsterEntries should not report malformed JSON as ErrNoDefinition")
+	}
+}
+
+func TestDecodeMerriamWebsterEntriesEmptyArray(t *testing.T) {
+	body := io.NopCloser(strings.NewReader(`[]`))
+
+	_, err := decodeMerriamWebsterEntries(body)
+	if !errors.Is(err, ErrNoDefinition) {
+		t.Errorf("decodeMerriamWebsterEntries error = %v, want ErrNoDefinition", err)
+	}
+}
+
+func TestDecodeMerriamWebsterEntriesValidEntries(t *testing.T) {
+	body := io.NopCloser(strings.NewReader(`[{"meta": {"id": "word:1"}, "fl": "noun", "shortdef": ["a thing"]}]`))
+
+	entries, err := decodeMerriamWebsterEntries(body)
+	if err != nil {
+		t.Fatalf("decodeMerriamWebsterEntries returned error: %v", err)
+	}
+	if len(entries) != 1 || entries[0].PartOfSpeech != "noun" {
+		t.Errorf("entries = %v, want one noun entry", entries)
+	}
+}
+
+// mustDecodeEntry unmarshals a single Merriam-Webster entry literal into an
+// mwEntry for use by extractExamples/parseSenseExamples tests.
+func mustDecodeEntry(t *testing.T, raw string) mwEntry {
+	t.Helper()
+
+	var entry mwEntry
+	if err := json.Unmarshal([]byte(raw), &entry); err != nil {
+		t.Fatalf("failed to decode test fixture: %v", err)
+	}
+	return entry
+}
+
+func TestExtractExamplesStripsHighlightMarkup(t *testing.T) {
+	entry := mustDecodeEntry(t, `{
+		"fl": "noun",
+		"shortdef": ["a heavy metal"],
+		"def": [{
+			"sseq": [[
+				["sense", {"dt": [["vis", [{"t": "the {wi}lead{/wi} pipe burst"}]]]}]
+			]]
+		}]
+	}`)
+
+	examples := extractExamples(entry)
+	if len(examples) != 1 || examples[0] != "the lead pipe burst" {
+		t.Errorf("extractExamples = %v, want [the lead pipe burst]", examples)
+	}
+}
+
+func TestExtractExamplesCollectsAcrossSenseSequences(t *testing.T) {
+	entry := mustDecodeEntry(t, `{
+		"fl": "verb",
+		"shortdef": ["to guide"],
+		"def": [{
+			"sseq": [
+				[["sense", {"dt": [["vis", [{"t": "lead the way"}]]]}]],
+				[["sense", {"dt": [["vis", [{"t": "lead by example"}]]]}]]
+			]
+		}]
+	}`)
+
+	examples := extractExamples(entry)
+	if len(examples) != 2 || examples[0] != "lead the way" || examples[1] != "lead by example" {
+		t.Errorf("extractExamples = %v, want [lead the way, lead by example]", examples)
+	}
+}
+
+func TestExtractExamplesIgnoresNonSenseAndNonVisNodes(t *testing.T) {
+	entry := mustDecodeEntry(t, `{
+		"fl": "noun",
+		"shortdef": ["a heavy metal"],
+		"def": [{
+			"sseq": [[
+				["pseq", [["sense", {"dt": [["vis", [{"t": "should be ignored"}]]]}]]],
+				["sense", {"dt": [["uns", [{"t": "not an example"}]], ["vis", [{"t": "kept"}]]]}]
+			]]
+		}]
+	}`)
+
+	examples := extractExamples(entry)
+	if len(examples) != 1 || examples[0] != "kept" {
+		t.Errorf("extractExamples = %v, want [kept]", examples)
+	}
+}
+
+func TestParseSenseExamplesMultipleVisEntries(t *testing.T) {
+	var dt []json.RawMessage
+	if err := json.Unmarshal([]byte(`[["vis", [{"t": "first"}, {"t": "second"}]]]`), &dt); err != nil {
+		t.Fatalf("failed to decode test fixture: %v", err)
+	}
+
+	examples := parseSenseExamples(dt)
+	if len(examples) != 2 || examples[0] != "first" || examples[1] != "second" {
+		t.Errorf("parseSenseExamples = %v, want [first, second]", examples)
+	}
+}
+
+func senseTestCards() []Card {
+	return []Card{
+		{Word: "lead", PartOfSpeech: "noun", Definitions: []string{"a heavy metal"}},
+		{Word: "lead", PartOfSpeech: "verb", Definitions: []string{"to guide"}},
+		{Word: "lead", PartOfSpeech: "adjective", Definitions: []string{"most important"}},
+	}
+}
+
+func TestSelectSensesSingleCardSkipsPrompt(t *testing.T) {
+	cards := []Card{{Word: "cat", PartOfSpeech: "noun"}}
+
+	selected, err := selectSenses(cards, SelectInteractive, bufio.NewReader(strings.NewReader("")))
+	if err != nil {
+		t.Fatalf("selectSenses returned error: %v", err)
+	}
+	if len(selected) != 1 {
+		t.Errorf("selected = %v, want the single card returned untouched", selected)
+	}
+}
+
+func TestSelectSensesFirstAndAllBypassPrompt(t *testing.T) {
+	cards := senseTestCards()
+
+	first, err := selectSenses(cards, SelectFirst, bufio.NewReader(strings.NewReader("")))
+	if err != nil {
+		t.Fatalf("selectSenses(SelectFirst) returned error: %v", err)
+	}
+	if len(first) != 1 || first[0].PartOfSpeech != "noun" {
+		t.Errorf("selectSenses(SelectFirst) = %v, want just the first sense", first)
+	}
+
+	all, err := selectSenses(cards, SelectAll, bufio.NewReader(strings.NewReader("")))
+	if err != nil {
+		t.Fatalf("selectSenses(SelectAll) returned error: %v", err)
+	}
+	if len(all) != len(cards) {
+		t.Errorf("selectSenses(SelectAll) = %v, want all %d senses", all, len(cards))
+	}
+}
+
+func TestPromptForSensesParsesCommaSeparatedNumbers(t *testing.T) {
+	cards := senseTestCards()
+
+	selected, err := promptForSenses(cards, bufio.NewReader(strings.NewReader("1,3\n")))
+	if err != nil {
+		t.Fatalf("promptForSenses returned error: %v", err)
+	}
+	if len(selected) != 2 || selected[0].PartOfSpeech != "noun" || selected[1].PartOfSpeech != "adjective" {
+		t.Errorf("selected = %v, want [noun, adjective]", selected)
+	}
+}
+
+func TestPromptForSensesAll(t *testing.T) {
+	cards := senseTestCards()
+
+	selected, err := promptForSenses(cards, bufio.NewReader(strings.NewReader("all\n")))
+	if err != nil {
+		t.Fatalf("promptForSenses returned error: %v", err)
+	}
+	if len(selected) != len(cards) {
+		t.Errorf("selected = %v, want all %d senses", selected, len(cards))
+	}
+}
+
+func TestPromptForSensesIgnoresOutOfRangeAndJunkInput(t *testing.T) {
+	cards := senseTestCards()
+
+	selected, err := promptForSenses(cards, bufio.NewReader(strings.NewReader("0,2,9,nope\n")))
+	if err != nil {
+		t.Fatalf("promptForSenses returned error: %v", err)
+	}
+	if len(selected) != 1 || selected[0].PartOfSpeech != "verb" {
+		t.Errorf("selected = %v, want just the verb sense", selected)
+	}
+}
+
+func TestPromptForSensesEmptyInputSelectsNothing(t *testing.T) {
+	cards := senseTestCards()
+
+	selected, err := promptForSenses(cards, bufio.NewReader(strings.NewReader("\n")))
+	if err != nil {
+		t.Fatalf("promptForSenses returned error: %v", err)
+	}
+	if len(selected) != 0 {
+		t.Errorf("selected = %v, want no senses selected", selected)
+	}
+}
+
+func TestQueueRoundTrip(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	queued, err := loadQueue()
+	if err != nil {
+		t.Fatalf("loadQueue on an empty queue returned error: %v", err)
+	}
+	if len(queued) != 0 {
+		t.Fatalf("loadQueue on an empty queue = %v, want none", queued)
+	}
+
+	if err := enqueueWords([]string{"cat", "dog"}); err != nil {
+		t.Fatalf("enqueueWords returned error: %v", err)
+	}
+	if err := enqueueWords([]string{"fish"}); err != nil {
+		t.Fatalf("enqueueWords returned error: %v", err)
+	}
+
+	queued, err = loadQueue()
+	if err != nil {
+		t.Fatalf("loadQueue returned error: %v", err)
+	}
+	if len(queued) != 3 {
+		t.Fatalf("loadQueue = %v, want 3 words", queued)
+	}
+	for i, want := range []string{"cat", "dog", "fish"} {
+		if queued[i].Word != want {
+			t.Errorf("queued[%d].Word = %q, want %q", i, queued[i].Word, want)
+		}
+	}
+
+	// Simulate a sync draining "cat" and "fish" but leaving "dog" queued.
+	if err := rewriteQueue([]queuedWord{queued[1]}); err != nil {
+		t.Fatalf("rewriteQueue returned error: %v", err)
+	}
+
+	queued, err = loadQueue()
+	if err != nil {
+		t.Fatalf("loadQueue after rewrite returned error: %v", err)
+	}
+	if len(queued) != 1 || queued[0].Word != "dog" {
+		t.Fatalf("loadQueue after rewrite = %v, want just [dog]", queued)
+	}
+
+	// Rewriting down to empty should remove the queue file entirely.
+	if err := rewriteQueue(nil); err != nil {
+		t.Fatalf("rewriteQueue(nil) returned error: %v", err)
+	}
+
+	_, path, err := queuePaths()
+	if err != nil {
+		t.Fatalf("queuePaths returned error: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("queue file still exists after rewriteQueue(nil): %v", err)
+	}
+
+	queued, err = loadQueue()
+	if err != nil {
+		t.Fatalf("loadQueue after emptying returned error: %v", err)
+	}
+	if len(queued) != 0 {
+		t.Errorf("loadQueue after emptying = %v, want none", queued)
+	}
+}
+
+func TestReadWordsFromPositionalArgs(t *testing.T) {
+	words, fromStdin, err := readWords([]string{"cat", "dog"})
+	if err != nil {
+		t.Fatalf("readWords returned error: %v", err)
+	}
+	if fromStdin {
+		t.Error("fromStdin = true, want false for positional args")
+	}
+	if len(words) != 2 || words[0] != "cat" || words[1] != "dog" {
+		t.Errorf("words = %v, want [cat dog]", words)
+	}
+}
+
+func TestReadWordsFromStdin(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create pipe: %v", err)
+	}
+
+	originalStdin := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = originalStdin }()
+
+	go func() {
+		w.WriteString("cat\n\n  dog  \n")
+		w.Close()
+	}()
+
+	words, fromStdin, err := readWords([]string{"-"})
+	if err != nil {
+		t.Fatalf("readWords returned error: %v", err)
+	}
+	if !fromStdin {
+		t.Error("fromStdin = false, want true when reading \"-\"")
+	}
+	if len(words) != 2 || words[0] != "cat" || words[1] != "dog" {
+		t.Errorf("words = %v, want [cat dog] (blank lines skipped, whitespace trimmed)", words)
+	}
+}
+
+func TestEffectiveConcurrency(t *testing.T) {
+	cases := []struct {
+		name     string
+		config   Config
+		mode     SenseSelectionMode
+		numWords int
+		want     int
+	}{
+		{"defaults when unset", Config{}, SelectFirst, 10, defaultMaxConcurrency},
+		{"capped to word count", Config{MaxConcurrency: 8}, SelectAll, 3, 3},
+		{"configured value under word count", Config{MaxConcurrency: 2}, SelectFirst, 10, 2},
+		{"forced serial when interactive", Config{MaxConcurrency: 8}, SelectInteractive, 10, 1},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := effectiveConcurrency(c.config, c.mode, c.numWords)
+			if got != c.want {
+				t.Errorf("effectiveConcurrency() = %d, want %d", got, c.want)
+			}
+		})
+	}
+}
+
+// fakeCardsManager implements ankiconnect.CardsManager, treating any word in
+// duplicateWords as already present in the deck.
+type fakeCardsManager struct {
+	duplicateWords map[string]bool
+}
+
+func (f fakeCardsManager) Search(query string) (*[]int64, *bksterrors.RestErr) {
+	return nil, nil
+}
+
+func (f fakeCardsManager) Get(query string) (*[]ankiconnect.ResultCardsInfo, *bksterrors.RestErr) {
+	for word, duplicate := range f.duplicateWords {
+		if duplicate && strings.Contains(query, `"front:`+word+`"`) {
+			found := []ankiconnect.ResultCardsInfo{{}}
+			return &found, nil
+		}
+	}
+
+	none := []ankiconnect.ResultCardsInfo{}
+	return &none, nil
+}
+
+// fakeNotesManager implements ankiconnect.NotesManager, always succeeding.
+type fakeNotesManager struct{}
+
+func (f fakeNotesManager) Add(note ankiconnect.Note) *bksterrors.RestErr {
+	return nil
+}
+
+func (f fakeNotesManager) Search(query string) (*[]int64, *bksterrors.RestErr) {
+	return nil, nil
+}
+
+func (f fakeNotesManager) Get(query string) (*[]ankiconnect.ResultNotesInfo, *bksterrors.RestErr) {
+	return nil, nil
+}
+
+func (f fakeNotesManager) Update(note ankiconnect.UpdateNote) *bksterrors.RestErr {
+	return nil
+}
+
+// perWordProvider is a DictionaryProvider whose result depends only on the
+// word, for driving processWords through every outcome in one fan-out.
+type perWordProvider struct{}
+
+func (p perWordProvider) Lookup(word string) (Card, error) {
+	switch word {
+	case "added", "skipped":
+		return Card{Word: word, PartOfSpeech: "noun", Definitions: []string{"a definition"}}, nil
+	case "failed":
+		return Card{}, ErrNoDefinition
+	case "offline":
+		return Card{}, errors.New("network down")
+	}
+	return Card{}, ErrNoDefinition
+}
+
+func TestProcessWordsMixedOutcomes(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	client := &ankiconnect.Client{
+		Cards: fakeCardsManager{duplicateWords: map[string]bool{"skipped": true}},
+		Notes: fakeNotesManager{},
+	}
+	config := Config{DeckName: "Test", ModelName: "dict2anki"}
+	providers := []DictionaryProvider{perWordProvider{}}
+	words := []string{"added", "skipped", "failed", "offline"}
+
+	summary := processWords(client, config, providers, words, SelectFirst, strings.NewReader(""), true)
+
+	if summary.Added != 1 {
+		t.Errorf("Added = %d, want 1", summary.Added)
+	}
+	if summary.Skipped != 1 {
+		t.Errorf("Skipped = %d, want 1", summary.Skipped)
+	}
+	if summary.Failed != 1 {
+		t.Errorf("Failed = %d, want 1", summary.Failed)
+	}
+	if summary.Queued != 1 {
+		t.Errorf("Queued = %d, want 1", summary.Queued)
+	}
+}